@@ -0,0 +1,163 @@
+package zap
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// gelfPassthroughFields are the reserved fields this package injects itself
+// (version, host) and that must therefore bypass the "_" prefixing
+// gelfFieldKey applies to every other reserved name.
+var gelfPassthroughFields = map[string]bool{
+	"version": true,
+	"host":    true,
+}
+
+// gelfKeyCharset matches everything NOT allowed in a GELF additional field
+// name; GELF 1.1 restricts keys to [\w\.\-].
+var gelfKeyCharset = regexp.MustCompile(`[^\w.\-]`)
+
+// gelfFieldKey rewrites a zap field key into a valid GELF 1.1 additional
+// field name: restricted to the [\w.-] charset and prefixed with "_". Every
+// non-passthrough key is prefixed unconditionally rather than only the
+// seven GELF top-level names (id, version, host, timestamp, level,
+// short_message, full_message), since that already renames id, timestamp,
+// level, short_message and full_message when a caller uses them and needs no
+// separate reserved-word list; the only keys left unprefixed are
+// gelfPassthroughFields, which this package injects as the real top-level
+// fields. A caller's own "version" or "host" field is left unprefixed as well.
+func gelfFieldKey(key string) string {
+	if gelfPassthroughFields[key] {
+		return key
+	}
+
+	sanitized := gelfKeyCharset.ReplaceAllString(key, "_")
+	if strings.HasPrefix(sanitized, "_") {
+		return sanitized
+	}
+
+	return "_" + sanitized
+}
+
+// gelfFieldEncoder wraps a zapcore.Encoder and enforces the GELF 1.1 rules
+// for additional fields: keys are restricted to the [\w.-] charset and
+// prefixed with "_", with reserved names renamed rather than rejected so a
+// misnamed field is never silently dropped; "version" and "host" are the
+// exception and keep their names (see gelfFieldKey). It belongs next to
+// getGelfEncoderConfig(), which handles the GELF top-level keys.
+//
+// Renaming has to happen in two places. Add* covers fields baked into a
+// core via With (zap.Config's InitialFields, logger.With(...)); those are
+// the only fields zap ever runs through the encoder's ObjectEncoder
+// methods. Per-call fields passed to Info/Error/etc. never reach Add* at
+// all - Core.Write hands them straight to EncodeEntry, whose default
+// implementation clones the concrete encoder and encodes them itself - so
+// EncodeEntry must rewrite that fields slice before delegating, or per-call
+// keys would reach Graylog unprefixed.
+type gelfFieldEncoder struct {
+	zapcore.Encoder
+}
+
+func newGelfFieldEncoder(enc zapcore.Encoder) zapcore.Encoder {
+	return &gelfFieldEncoder{Encoder: enc}
+}
+
+func (e *gelfFieldEncoder) Clone() zapcore.Encoder {
+	return &gelfFieldEncoder{Encoder: e.Encoder.Clone()}
+}
+
+func (e *gelfFieldEncoder) EncodeEntry(entry zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	renamed := make([]zapcore.Field, len(fields))
+	for i, field := range fields {
+		field.Key = gelfFieldKey(field.Key)
+		renamed[i] = field
+	}
+
+	return e.Encoder.EncodeEntry(entry, renamed)
+}
+
+func (e *gelfFieldEncoder) AddArray(key string, v zapcore.ArrayMarshaler) error {
+	return e.Encoder.AddArray(gelfFieldKey(key), v)
+}
+
+func (e *gelfFieldEncoder) AddObject(key string, v zapcore.ObjectMarshaler) error {
+	return e.Encoder.AddObject(gelfFieldKey(key), v)
+}
+
+func (e *gelfFieldEncoder) AddReflected(key string, v interface{}) error {
+	return e.Encoder.AddReflected(gelfFieldKey(key), v)
+}
+
+func (e *gelfFieldEncoder) OpenNamespace(key string) {
+	e.Encoder.OpenNamespace(gelfFieldKey(key))
+}
+
+func (e *gelfFieldEncoder) AddBinary(key string, v []byte)     { e.Encoder.AddBinary(gelfFieldKey(key), v) }
+func (e *gelfFieldEncoder) AddByteString(key string, v []byte) { e.Encoder.AddByteString(gelfFieldKey(key), v) }
+func (e *gelfFieldEncoder) AddBool(key string, v bool)         { e.Encoder.AddBool(gelfFieldKey(key), v) }
+func (e *gelfFieldEncoder) AddComplex128(key string, v complex128) {
+	e.Encoder.AddComplex128(gelfFieldKey(key), v)
+}
+func (e *gelfFieldEncoder) AddComplex64(key string, v complex64) {
+	e.Encoder.AddComplex64(gelfFieldKey(key), v)
+}
+func (e *gelfFieldEncoder) AddDuration(key string, v time.Duration) {
+	e.Encoder.AddDuration(gelfFieldKey(key), v)
+}
+func (e *gelfFieldEncoder) AddFloat64(key string, v float64) { e.Encoder.AddFloat64(gelfFieldKey(key), v) }
+func (e *gelfFieldEncoder) AddFloat32(key string, v float32) { e.Encoder.AddFloat32(gelfFieldKey(key), v) }
+func (e *gelfFieldEncoder) AddInt(key string, v int)         { e.Encoder.AddInt(gelfFieldKey(key), v) }
+func (e *gelfFieldEncoder) AddInt64(key string, v int64)     { e.Encoder.AddInt64(gelfFieldKey(key), v) }
+func (e *gelfFieldEncoder) AddInt32(key string, v int32)     { e.Encoder.AddInt32(gelfFieldKey(key), v) }
+func (e *gelfFieldEncoder) AddInt16(key string, v int16)     { e.Encoder.AddInt16(gelfFieldKey(key), v) }
+func (e *gelfFieldEncoder) AddInt8(key string, v int8)       { e.Encoder.AddInt8(gelfFieldKey(key), v) }
+func (e *gelfFieldEncoder) AddString(key, v string)          { e.Encoder.AddString(gelfFieldKey(key), v) }
+func (e *gelfFieldEncoder) AddTime(key string, v time.Time)  { e.Encoder.AddTime(gelfFieldKey(key), v) }
+func (e *gelfFieldEncoder) AddUint(key string, v uint)       { e.Encoder.AddUint(gelfFieldKey(key), v) }
+func (e *gelfFieldEncoder) AddUint64(key string, v uint64)   { e.Encoder.AddUint64(gelfFieldKey(key), v) }
+func (e *gelfFieldEncoder) AddUint32(key string, v uint32)   { e.Encoder.AddUint32(gelfFieldKey(key), v) }
+func (e *gelfFieldEncoder) AddUint16(key string, v uint16)   { e.Encoder.AddUint16(gelfFieldKey(key), v) }
+func (e *gelfFieldEncoder) AddUint8(key string, v uint8)     { e.Encoder.AddUint8(gelfFieldKey(key), v) }
+func (e *gelfFieldEncoder) AddUintptr(key string, v uintptr) { e.Encoder.AddUintptr(gelfFieldKey(key), v) }
+
+// newStrictGelfCore builds a core by hand instead of going through
+// zap.Config.Build, so the JSON encoder can be wrapped in gelfFieldEncoder.
+// It backs GelfStreamZapFactory.New when "strict_gelf: true" is configured.
+func newStrictGelfCore(loggerConf zap.Config) (zapcore.Core, error) {
+	sink, _, err := zap.Open(loggerConf.OutputPaths...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open log sinks")
+	}
+
+	encoder := newGelfFieldEncoder(zapcore.NewJSONEncoder(loggerConf.EncoderConfig))
+
+	var core zapcore.Core = zapcore.NewCore(encoder, sink, loggerConf.Level)
+	if loggerConf.Sampling != nil {
+		core = zapcore.NewSamplerWithOptions(core, time.Second, loggerConf.Sampling.Initial, loggerConf.Sampling.Thereafter)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to resolve hostname")
+	}
+
+	fields := make([]zapcore.Field, 0, len(loggerConf.InitialFields)+2)
+	for key, value := range loggerConf.InitialFields {
+		// The GELF 1.1 "version" field is the spec literal below, not the
+		// app version optionally carried in InitialFields.
+		if key == "version" {
+			continue
+		}
+		fields = append(fields, zap.Any(key, value))
+	}
+	fields = append(fields, zap.String("version", "1.1"), zap.String("host", hostname))
+
+	return core.With(fields), nil
+}
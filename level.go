@@ -0,0 +1,103 @@
+package zap
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// levelRegistry holds the zap.AtomicLevel of every core built through this
+// package, keyed by the core's configured name (the last segment of the
+// viper path it was built from). It lets operators raise or lower verbosity
+// at runtime instead of baking the level into the core once at startup.
+var levelRegistry = struct {
+	mu     sync.RWMutex
+	levels map[string]zap.AtomicLevel
+}{
+	levels: make(map[string]zap.AtomicLevel),
+}
+
+func registerLevel(name string, level zap.AtomicLevel) {
+	levelRegistry.mu.Lock()
+	defer levelRegistry.mu.Unlock()
+
+	levelRegistry.levels[name] = level
+}
+
+func lookupLevel(name string) (zap.AtomicLevel, bool) {
+	levelRegistry.mu.RLock()
+	defer levelRegistry.mu.RUnlock()
+
+	level, ok := levelRegistry.levels[name]
+	return level, ok
+}
+
+// coreName extracts the configured core name from the viper path a
+// CoreFactory was built with, e.g. "zap.cores.json" -> "json".
+func coreName(path string) string {
+	parts := strings.Split(path, ".")
+	return parts[len(parts)-1]
+}
+
+// NewLevelHandler returns an http.Handler exposing the named core's
+// zap.AtomicLevel. Mount it at e.g. "/debug/log/level" to inspect the
+// current level with GET or change it at runtime with `PUT {"level":"debug"}`.
+func NewLevelHandler(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		level, ok := lookupLevel(name)
+		if !ok {
+			http.Error(w, fmt.Sprintf("zap: no core registered as %q", name), http.StatusNotFound)
+			return
+		}
+
+		level.ServeHTTP(w, r)
+	})
+}
+
+// levelHTTPListeners tracks which cores already have a dedicated level
+// listener running, so rebuilding a core on hot reload doesn't try to bind
+// "http_level_addr" a second time and fail with "address already in use".
+// The listener always serves the current level for the name, via
+// NewLevelHandler's lookupLevel, so it never needs to be restarted.
+var levelHTTPListeners = struct {
+	mu      sync.Mutex
+	started map[string]bool
+}{
+	started: make(map[string]bool),
+}
+
+// serveLevelHTTP starts a dedicated listener exposing the named core's level
+// endpoint, used when "zap.cores.<name>.http_level_addr" is configured. It
+// is a no-op if a listener for name is already running.
+func serveLevelHTTP(name, addr string) error {
+	levelHTTPListeners.mu.Lock()
+	if levelHTTPListeners.started[name] {
+		levelHTTPListeners.mu.Unlock()
+		return nil
+	}
+	levelHTTPListeners.started[name] = true
+	levelHTTPListeners.mu.Unlock()
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		levelHTTPListeners.mu.Lock()
+		delete(levelHTTPListeners.started, name)
+		levelHTTPListeners.mu.Unlock()
+
+		return errors.Wrap(err, "failed to start log level listener")
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/debug/log/level", NewLevelHandler(name))
+
+	go func() {
+		_ = http.Serve(ln, mux)
+	}()
+
+	return nil
+}
@@ -0,0 +1,412 @@
+package zap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var _ CoreFactory = (*GelfNetworkZapFactory)(nil)
+
+const (
+	gelfChunkMagicByte0 = 0x1e
+	gelfChunkMagicByte1 = 0x0f
+	gelfChunkHeaderSize = 12
+	gelfMaxChunkCount   = 128
+
+	gelfDefaultChunkSize = 8192
+	gelfDefaultTransport = "udp"
+	gelfDefaultCompress  = "gzip"
+
+	gelfWriteQueueSize = 1024
+	gelfMinBackoff     = 500 * time.Millisecond
+	gelfMaxBackoff     = 30 * time.Second
+	gelfSyncTimeout    = 5 * time.Second
+	gelfSyncPollPeriod = 20 * time.Millisecond
+)
+
+// GelfNetworkZapFactory writes GELF messages directly to a Graylog input over
+// UDP/TCP/TLS per https://go2docs.graylog.org/5-1/getting_in_log_data/gelf.html,
+// so there is no need for an external sidecar to reach Graylog.
+/*
+Example for yaml configuration
+zap:
+	  cores:
+		graylog:
+		  type: "gelf"
+		  level: "info"
+		  transport: "udp"
+		  address: "graylog.example.com:12201"
+		  compression: "gzip"
+		  chunk_size: 8192
+*/
+type GelfNetworkZapFactory struct {
+}
+
+func NewGelfNetworkZapFactory() *GelfNetworkZapFactory {
+	return &GelfNetworkZapFactory{}
+}
+
+func (g GelfNetworkZapFactory) Name() string {
+	return "gelf"
+}
+
+func (g GelfNetworkZapFactory) New(conf *viper.Viper, path string) (zapcore.Core, error) {
+	var address, transport, compression, hostname string
+	var chunkSize int
+	{
+		address = conf.GetString(path + ".address")
+		if address == "" {
+			return nil, errors.New("gelf: \"address\" is required")
+		}
+
+		transport = gelfDefaultTransport
+		if key := path + ".transport"; conf.IsSet(key) {
+			transport = conf.GetString(key)
+		}
+
+		compression = gelfDefaultCompress
+		if key := path + ".compression"; conf.IsSet(key) {
+			compression = conf.GetString(key)
+		}
+
+		chunkSize = gelfDefaultChunkSize
+		if key := path + ".chunk_size"; conf.IsSet(key) {
+			chunkSize = conf.GetInt(key)
+		}
+
+		hostname = conf.GetString(path + ".hostname")
+		if hostname == "" {
+			var err error
+			if hostname, err = os.Hostname(); err != nil {
+				return nil, errors.Wrap(err, "failed to resolve hostname")
+			}
+		}
+	}
+
+	writer, err := newGelfWriter(transport, address, compression, chunkSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create gelf writer")
+	}
+
+	var level zap.AtomicLevel
+	{
+		level = zap.NewAtomicLevel()
+
+		key := path + ".level"
+		if conf.IsSet(key) {
+			parsed, err := zap.ParseAtomicLevel(conf.GetString(key))
+			if err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("cannot parse log level %s", conf.GetString(key)))
+			}
+			level = parsed
+		}
+	}
+
+	encoderConf := getGelfEncoderConfig()
+	encoderConf.EncodeLevel = gelfLvlEncoder
+	// newGelfFieldEncoder also overrides EncodeEntry, so per-call fields
+	// (zap.String("userId", ...) on a log call, not just With/InitialFields)
+	// are prefixed with "_" before they go out over the wire.
+	encoder := newGelfFieldEncoder(zapcore.NewJSONEncoder(encoderConf))
+
+	var core zapcore.Core
+	{
+		inner := zapcore.NewCore(encoder, writer, level)
+		inner = inner.With([]zapcore.Field{
+			zap.String("version", "1.1"),
+			zap.String("host", hostname),
+		})
+		core = &gelfNetworkCore{Core: inner, writer: writer}
+	}
+
+	name := coreName(path)
+	registerLevel(name, level)
+
+	if addr := conf.GetString(path + ".http_level_addr"); addr != "" {
+		if err := serveLevelHTTP(name, addr); err != nil {
+			return nil, err
+		}
+	}
+
+	return core, nil
+}
+
+// gelfNetworkCore bundles the zapcore.Core built around a gelfWriter with
+// that writer, so a caller that knows to look for io.Closer (such as the
+// core registry's hot-reload swap) can shut down the writer's background
+// goroutine and connection once the core is replaced.
+type gelfNetworkCore struct {
+	zapcore.Core
+	writer *gelfWriter
+}
+
+func (c *gelfNetworkCore) Close() error {
+	return c.writer.Close()
+}
+
+// gelfWriter is a zapcore.WriteSyncer that delivers GELF payloads to a
+// Graylog input over UDP/TCP/TLS. Writes are buffered through a bounded
+// channel and flushed by a background goroutine so that a Graylog outage
+// never blocks the caller; the connection is redialed with exponential
+// backoff on failure.
+type gelfWriter struct {
+	transport   string
+	address     string
+	compression string
+	chunkSize   int
+	tlsConfig   *tls.Config
+
+	queue     chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func newGelfWriter(transport, address, compression string, chunkSize int) (*gelfWriter, error) {
+	switch transport {
+	case "udp", "tcp", "tls":
+	default:
+		return nil, errors.Errorf("gelf: unsupported transport %q", transport)
+	}
+
+	if chunkSize <= gelfChunkHeaderSize {
+		return nil, errors.Errorf("gelf: chunk_size %d must be greater than the %d-byte chunk header", chunkSize, gelfChunkHeaderSize)
+	}
+
+	w := &gelfWriter{
+		transport:   transport,
+		address:     address,
+		compression: compression,
+		chunkSize:   chunkSize,
+		queue:       make(chan []byte, gelfWriteQueueSize),
+		done:        make(chan struct{}),
+	}
+	if transport == "tls" {
+		w.tlsConfig = &tls.Config{}
+	}
+
+	w.wg.Add(1)
+	go w.loop()
+
+	return w, nil
+}
+
+func (w *gelfWriter) Write(p []byte) (int, error) {
+	msg := make([]byte, len(p))
+	copy(msg, p)
+
+	select {
+	case w.queue <- msg:
+	default:
+		// The broker is unreachable or behind: drop the entry rather than
+		// block the caller.
+	}
+
+	return len(p), nil
+}
+
+func (w *gelfWriter) Sync() error {
+	deadline := time.After(gelfSyncTimeout)
+	for len(w.queue) > 0 {
+		select {
+		case <-deadline:
+			return errors.New("gelf: timed out flushing write queue")
+		case <-time.After(gelfSyncPollPeriod):
+		}
+	}
+
+	return nil
+}
+
+// Close stops the background flush loop and closes the connection. It is
+// safe to call more than once.
+func (w *gelfWriter) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.done)
+	})
+	w.wg.Wait()
+	w.closeConn()
+
+	return nil
+}
+
+func (w *gelfWriter) loop() {
+	defer w.wg.Done()
+
+	backoff := gelfMinBackoff
+	for {
+		select {
+		case <-w.done:
+			return
+		case msg := <-w.queue:
+			if err := w.send(msg); err != nil {
+				w.closeConn()
+
+				time.Sleep(backoff)
+				if backoff *= 2; backoff > gelfMaxBackoff {
+					backoff = gelfMaxBackoff
+				}
+				continue
+			}
+
+			backoff = gelfMinBackoff
+		}
+	}
+}
+
+func (w *gelfWriter) send(msg []byte) error {
+	conn, err := w.dial()
+	if err != nil {
+		return err
+	}
+
+	if w.transport == "udp" {
+		return w.sendUDP(conn, msg)
+	}
+
+	return w.sendTCP(conn, msg)
+}
+
+func (w *gelfWriter) dial() (net.Conn, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn != nil {
+		return w.conn, nil
+	}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	switch w.transport {
+	case "udp":
+		conn, err = net.Dial("udp", w.address)
+	case "tcp":
+		conn, err = net.Dial("tcp", w.address)
+	case "tls":
+		conn, err = tls.Dial("tcp", w.address, w.tlsConfig)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "gelf: failed to connect")
+	}
+
+	w.conn = conn
+	return conn, nil
+}
+
+func (w *gelfWriter) closeConn() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn != nil {
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+}
+
+// sendUDP compresses the message (per gelfWriter.compression) and, if it
+// still exceeds chunkSize, splits it into up to gelfMaxChunkCount GELF
+// chunks, each carrying the 12-byte chunking header from the spec: 2-byte
+// magic (0x1e 0x0f), 8-byte message id, 1-byte sequence number, 1-byte
+// sequence count.
+func (w *gelfWriter) sendUDP(conn net.Conn, msg []byte) error {
+	payload, err := w.compress(msg)
+	if err != nil {
+		return err
+	}
+
+	if len(payload) <= w.chunkSize {
+		_, err = conn.Write(payload)
+		return err
+	}
+
+	return w.sendChunked(conn, payload)
+}
+
+func (w *gelfWriter) sendChunked(conn net.Conn, payload []byte) error {
+	dataSize := w.chunkSize - gelfChunkHeaderSize
+	chunkCount := (len(payload) + dataSize - 1) / dataSize
+	if chunkCount > gelfMaxChunkCount {
+		return errors.Errorf("gelf: message requires %d chunks, exceeding the %d chunk limit", chunkCount, gelfMaxChunkCount)
+	}
+
+	var msgID [8]byte
+	if _, err := rand.Read(msgID[:]); err != nil {
+		return errors.Wrap(err, "gelf: failed to generate message id")
+	}
+
+	for seq := 0; seq < chunkCount; seq++ {
+		start := seq * dataSize
+		end := start + dataSize
+		if end > len(payload) {
+			end = len(payload)
+		}
+
+		chunk := make([]byte, 0, gelfChunkHeaderSize+end-start)
+		chunk = append(chunk, gelfChunkMagicByte0, gelfChunkMagicByte1)
+		chunk = append(chunk, msgID[:]...)
+		chunk = append(chunk, byte(seq), byte(chunkCount))
+		chunk = append(chunk, payload[start:end]...)
+
+		if _, err := conn.Write(chunk); err != nil {
+			return errors.Wrap(err, "gelf: failed to write chunk")
+		}
+	}
+
+	return nil
+}
+
+// sendTCP frames the message with a trailing NUL byte as required by the
+// GELF TCP transport; TCP/TLS payloads are never compressed.
+func (w *gelfWriter) sendTCP(conn net.Conn, msg []byte) error {
+	framed := make([]byte, 0, len(msg)+1)
+	framed = append(framed, msg...)
+	framed = append(framed, 0)
+
+	_, err := conn.Write(framed)
+	return err
+}
+
+func (w *gelfWriter) compress(msg []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	switch w.compression {
+	case "gzip":
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(msg); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	case "zlib":
+		zw := zlib.NewWriter(&buf)
+		if _, err := zw.Write(msg); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		return msg, nil
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,123 @@
+package zap
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	lumberjackSinkScheme = "lumberjack"
+
+	defaultSamplingInitial    = 100
+	defaultSamplingThereafter = 100
+)
+
+func init() {
+	if err := zap.RegisterSink(lumberjackSinkScheme, newLumberjackSink); err != nil {
+		panic(err)
+	}
+}
+
+// applyCoreOutputConfig wires the sampling, output-path and rotation settings
+// shared by every CoreFactory that builds its core through a zap.Config:
+// `sampling.initial` / `sampling.thereafter` (defaulting to 100/100 once
+// `sampling` is set), plus `output_paths` / `error_output_paths`. Any of
+// those paths may use the `lumberjack://` scheme registered above to rotate
+// a file in-process via gopkg.in/natefinch/lumberjack.v2 instead of relying
+// on an external log rotator.
+func applyCoreOutputConfig(conf *viper.Viper, rootPath string, loggerConf *zap.Config) {
+	if key := rootPath + ".sampling"; conf.IsSet(key) {
+		initial := defaultSamplingInitial
+		if conf.IsSet(key + ".initial") {
+			initial = conf.GetInt(key + ".initial")
+		}
+
+		thereafter := defaultSamplingThereafter
+		if conf.IsSet(key + ".thereafter") {
+			thereafter = conf.GetInt(key + ".thereafter")
+		}
+
+		loggerConf.Sampling = &zap.SamplingConfig{
+			Initial:    initial,
+			Thereafter: thereafter,
+		}
+	}
+
+	if key := rootPath + ".output_paths"; conf.IsSet(key) {
+		loggerConf.OutputPaths = conf.GetStringSlice(key)
+	}
+
+	if key := rootPath + ".error_output_paths"; conf.IsSet(key) {
+		loggerConf.ErrorOutputPaths = conf.GetStringSlice(key)
+	}
+}
+
+// newLumberjackSink adapts gopkg.in/natefinch/lumberjack.v2 to the zap.Sink
+// interface so an output path such as
+// "lumberjack:///var/log/app.log?max_size=100&max_backups=3&max_age=28&compress=true"
+// rotates the file the way gnet's logging package does. The path must use
+// the triple-slash absolute form: with only two slashes, url.Parse reads the
+// first path segment as the URL host and silently drops it from u.Path.
+func newLumberjackSink(u *url.URL) (zap.Sink, error) {
+	if u.Host != "" {
+		return nil, errors.Errorf(
+			"lumberjack: %q must use the triple-slash form lumberjack:///%s%s, otherwise %q is parsed as a host and dropped from the path",
+			u, u.Host, u.Path, u.Host,
+		)
+	}
+
+	logger := &lumberjack.Logger{
+		Filename: u.Path,
+	}
+
+	query := u.Query()
+	if v := query.Get("max_size"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("lumberjack: invalid max_size %q", v))
+		}
+		logger.MaxSize = size
+	}
+
+	if v := query.Get("max_backups"); v != "" {
+		backups, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("lumberjack: invalid max_backups %q", v))
+		}
+		logger.MaxBackups = backups
+	}
+
+	if v := query.Get("max_age"); v != "" {
+		age, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("lumberjack: invalid max_age %q", v))
+		}
+		logger.MaxAge = age
+	}
+
+	if v := query.Get("compress"); v != "" {
+		compress, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("lumberjack: invalid compress %q", v))
+		}
+		logger.Compress = compress
+	}
+
+	return lumberjackSink{logger}, nil
+}
+
+// lumberjackSink adds the no-op Sync that zap.Sink requires on top of
+// *lumberjack.Logger, which already satisfies io.WriteCloser.
+type lumberjackSink struct {
+	*lumberjack.Logger
+}
+
+func (lumberjackSink) Sync() error {
+	return nil
+}
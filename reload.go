@@ -0,0 +1,218 @@
+package zap
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+	"go.uber.org/zap/zapcore"
+)
+
+var _ zapcore.Core = (*ReloadableCore)(nil)
+
+// reloadableState is the mutex-guarded inner core shared by a ReloadableCore
+// and every core derived from it via With, so a swap on one is visible to
+// all of them. generation is bumped on every swap so derived cores know
+// when their cached With(fields) core is stale.
+type reloadableState struct {
+	mu         sync.RWMutex
+	inner      zapcore.Core
+	generation uint64
+}
+
+func (s *reloadableState) get() (zapcore.Core, uint64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.inner, s.generation
+}
+
+// swap installs inner as the new core and returns the one it replaced, so
+// the caller can release any resources (goroutines, connections) the
+// previous core held.
+func (s *reloadableState) swap(inner zapcore.Core) zapcore.Core {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.inner
+	s.inner = inner
+	s.generation++
+	return previous
+}
+
+// ReloadableCore wraps an inner zapcore.Core behind a sync.RWMutex so it can
+// be swapped atomically, mirroring the lockedMultiCore pattern: Check,
+// Enabled, Write and Sync take the read lock, Write and Sync holding it until
+// the inner core has finished, while swap takes the write lock. With only
+// records fields and reads no shared state, so it needs no lock. A failed
+// rebuild simply keeps the previous inner core in place, so logging never
+// breaks mid-reload.
+type ReloadableCore struct {
+	state  *reloadableState
+	fields []zapcore.Field
+
+	cacheMu  sync.Mutex
+	cacheGen uint64
+	cache    zapcore.Core
+}
+
+// NewReloadableCore wraps inner so it can later be swapped via swap.
+func NewReloadableCore(inner zapcore.Core) *ReloadableCore {
+	return &ReloadableCore{state: &reloadableState{inner: inner}}
+}
+
+func (c *ReloadableCore) swap(inner zapcore.Core) zapcore.Core {
+	return c.state.swap(inner)
+}
+
+// current returns the core that Write/Sync operate on: the inner core with
+// c.fields baked in via With, memoized per state.generation so a reload
+// doesn't force every log call to re-run With and re-encode the derived
+// core's accumulated fields. The caller must hold c.state.mu for reading.
+func (c *ReloadableCore) current() zapcore.Core {
+	inner, gen := c.state.inner, c.state.generation
+	if len(c.fields) == 0 {
+		return inner
+	}
+
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+
+	if c.cache == nil || c.cacheGen != gen {
+		c.cache = inner.With(c.fields)
+		c.cacheGen = gen
+	}
+
+	return c.cache
+}
+
+// Enabled only needs the current level, not a core with c.fields baked in,
+// so it reads the inner core directly instead of going through current().
+func (c *ReloadableCore) Enabled(lvl zapcore.Level) bool {
+	inner, _ := c.state.get()
+	return inner.Enabled(lvl)
+}
+
+func (c *ReloadableCore) With(fields []zapcore.Field) zapcore.Core {
+	merged := make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	merged = append(merged, c.fields...)
+	merged = append(merged, fields...)
+
+	return &ReloadableCore{state: c.state, fields: merged}
+}
+
+func (c *ReloadableCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+
+	return checked
+}
+
+func (c *ReloadableCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	c.state.mu.RLock()
+	defer c.state.mu.RUnlock()
+
+	return c.current().Write(entry, fields)
+}
+
+func (c *ReloadableCore) Sync() error {
+	c.state.mu.RLock()
+	defer c.state.mu.RUnlock()
+
+	return c.current().Sync()
+}
+
+// reloadRegistration tracks everything needed to rebuild a core when its
+// viper config changes: the factory that originally built it, the config
+// path it was built from, and the live ReloadableCore to swap.
+type reloadRegistration struct {
+	factory CoreFactory
+	path    string
+	core    *ReloadableCore
+}
+
+var reloadState = struct {
+	mu         sync.Mutex
+	registered map[*viper.Viper][]*reloadRegistration
+	watching   map[*viper.Viper]bool
+}{
+	registered: make(map[*viper.Viper][]*reloadRegistration),
+	watching:   make(map[*viper.Viper]bool),
+}
+
+// WrapReloadable builds a core through factory and wraps it in a
+// ReloadableCore that is rebuilt and hot-swapped whenever conf's underlying
+// config file changes, so level, encoding, GELF endpoint and fields can
+// change without restarting the process. Use this in place of calling
+// factory.New directly to opt a core into hot reload.
+func WrapReloadable(factory CoreFactory, conf *viper.Viper, path string) (zapcore.Core, error) {
+	inner, err := factory.New(conf, path)
+	if err != nil {
+		return nil, err
+	}
+
+	core := NewReloadableCore(inner)
+
+	reloadState.mu.Lock()
+	reloadState.registered[conf] = append(reloadState.registered[conf], &reloadRegistration{
+		factory: factory,
+		path:    path,
+		core:    core,
+	})
+	alreadyWatching := reloadState.watching[conf]
+	reloadState.watching[conf] = true
+	reloadState.mu.Unlock()
+
+	if !alreadyWatching {
+		conf.WatchConfig()
+		conf.OnConfigChange(func(_ fsnotify.Event) {
+			reloadAll(conf)
+		})
+	}
+
+	return core, nil
+}
+
+func reloadAll(conf *viper.Viper) {
+	reloadState.mu.Lock()
+	regs := append([]*reloadRegistration(nil), reloadState.registered[conf]...)
+	reloadState.mu.Unlock()
+
+	for _, reg := range regs {
+		inner, err := reg.factory.New(conf, reg.path)
+		if err != nil {
+			selfLog(fmt.Sprintf("zap: failed to reload core %q, keeping previous config: %v", coreName(reg.path), err))
+			continue
+		}
+
+		previous := reg.core.swap(inner)
+		closeCore(reg.path, previous)
+	}
+}
+
+// closableCore is implemented by cores (e.g. gelfNetworkCore) that hold a
+// background goroutine or connection that must be released once the core is
+// replaced; cores with nothing to release simply don't implement it.
+type closableCore interface {
+	Close() error
+}
+
+func closeCore(path string, core zapcore.Core) {
+	closer, ok := core.(closableCore)
+	if !ok {
+		return
+	}
+
+	if err := closer.Close(); err != nil {
+		selfLog(fmt.Sprintf("zap: failed to close previous core %q after reload: %v", coreName(path), err))
+	}
+}
+
+// selfLog reports reload failures without depending on the application
+// logger, which may itself be mid-reload.
+func selfLog(msg string) {
+	fmt.Fprintln(os.Stderr, msg)
+}
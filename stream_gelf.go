@@ -87,10 +87,23 @@ func (g GelfStreamZapFactory) New(conf *viper.Viper, path string) (zapcore.Core,
 		if conf.IsSet("app.version") {
 			loggerConf.InitialFields["version"] = conf.GetString("app.version")
 		}
+
+		applyCoreOutputConfig(conf, rootPath, &loggerConf)
 	}
 
-	var core zapcore.Core
+	var strictGelf bool
 	{
+		key = path + ".strict_gelf"
+		strictGelf = conf.IsSet(key) && conf.GetBool(key)
+	}
+
+	var core zapcore.Core
+	if strictGelf {
+		var err error
+		if core, err = newStrictGelfCore(loggerConf); err != nil {
+			return nil, err
+		}
+	} else {
 		logger, err := loggerConf.Build([]zap.Option{}...)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to build logger")
@@ -99,6 +112,15 @@ func (g GelfStreamZapFactory) New(conf *viper.Viper, path string) (zapcore.Core,
 		core = logger.Core()
 	}
 
+	name := coreName(path)
+	registerLevel(name, loggerConf.Level)
+
+	if addr := conf.GetString(path + ".http_level_addr"); addr != "" {
+		if err := serveLevelHTTP(name, addr); err != nil {
+			return nil, err
+		}
+	}
+
 	return core, nil
 }
 